@@ -17,8 +17,12 @@ limitations under the License.
 package grpc
 
 import (
+	"strings"
+
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+
+	"github.com/kubernetes-csi/external-snapshot-metadata/pkg/metrics"
 )
 
 const (
@@ -72,4 +76,54 @@ func (s *Server) statusPassOrWrapError(err error, c codes.Code, format string, a
 	}
 
 	return status.Errorf(c, format, args...)
-}
\ No newline at end of file
+}
+
+// reasonForError maps an internal error message to a stable,
+// low-cardinality reason label suitable for use on a Prometheus metric,
+// based on the message prefix constants declared above. It returns "" for
+// messages it does not recognize, so callers should not rely on it to
+// classify every possible failure.
+func reasonForError(msg string) string {
+	switch {
+	case strings.HasPrefix(msg, mgsInternalFailedToAuthorizePrefix):
+		return "failed_to_authorize"
+	case strings.HasPrefix(msg, msgInternalFailedToAuthenticatePrefix):
+		return "failed_to_authenticate"
+	case strings.HasPrefix(msg, msgInternalFailedCSIDriverResponse):
+		return "failed_csi_driver_response"
+	case strings.HasPrefix(msg, msgInternalFailedToSendResponse):
+		return "failed_to_send_response"
+	case strings.HasPrefix(msg, msgPermissionDeniedPrefix):
+		return "permission_denied"
+	case msg == msgUnauthenticatedUser:
+		return "unauthenticated_user"
+	case strings.HasPrefix(msg, msgUnavailableCSIDriverNotReady):
+		return "csi_driver_not_ready"
+	default:
+		return ""
+	}
+}
+
+// RecordRequestOutcome derives a stable reason from err (the error a
+// handler is about to return to the client, typically the result of
+// statusPassOrWrapError) and records it against op via mm. The reason is
+// derived from err's own status message rather than any input format
+// string, so it always reflects the code/reason that is actually observed
+// by the caller, even when err passed through statusPassOrWrapError
+// unchanged because it already carried a non-Unknown gRPC code.
+//
+// This is a standalone function, rather than a Server method, because the
+// handlers that would call it (and the Server.MetricsManager field they'd
+// read from) live in server.go, which is not part of this package in this
+// checkout; wiring callers should invoke it with the same MetricsManager
+// the handler's Server already holds.
+func RecordRequestOutcome(mm metrics.MetricsManager, op string, err error) {
+	code := codes.OK
+	reason := ""
+	if err != nil {
+		statusError := status.Convert(err)
+		code = statusError.Code()
+		reason = reasonForError(statusError.Message())
+	}
+	mm.RecordRequestOutcome(op, code, reason)
+}
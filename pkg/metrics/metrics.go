@@ -19,10 +19,12 @@ package metrics
 import (
 	"context"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc/codes"
 	"k8s.io/apimachinery/pkg/types"
 	k8smetrics "k8s.io/component-base/metrics"
 )
@@ -32,6 +34,8 @@ const (
 	labelDriverName               = "driver_name"
 	labelOperationName            = "operation_name"
 	labelOperationStatus          = "operation_status"
+	labelSnapshotGroup            = "is_group_snapshot"
+	labelSnapshotType             = "snapshot_type"
 	subSystem                     = "snapshot_metadata_controller"
 	operationLatencyMetricName    = "operation_total_seconds"
 	operationLatencyMetricHelpMsg = "Total number of seconds spent by the controller on an operation"
@@ -39,10 +43,52 @@ const (
 	operationInFlightHelpMsg      = "Total number of operations in flight"
 	unknownDriverName             = "unknown"
 
+	streamBytesMetricName       = "stream_bytes"
+	streamBytesMetricHelpMsg    = "Size in bytes of streamed response chunks sent to a client"
+	streamBlocksTotalMetricName = "stream_blocks_total"
+	streamBlocksTotalMetricHelp = "Total number of allocated/changed blocks reported across streamed response chunks"
+	streamActiveName            = "stream_active"
+	streamActiveHelpMsg         = "Total number of currently open GetMetadataAllocated/GetMetadataDelta client streams"
+
+	labelRequestCode   = "code"
+	labelRequestReason = "reason"
+	requestsTotalName  = "requests_total"
+	requestsTotalHelp  = "Total number of requests completed, by operation, gRPC status code and failure reason"
+
 	// DynamicSnapshotType represents a snapshot that is being dynamically provisioned
 	DynamicSnapshotType = snapshotProvisionType("dynamic")
 	// PreProvisionedSnapshotType represents a snapshot that is pre-provisioned
 	PreProvisionedSnapshotType = snapshotProvisionType("pre-provisioned")
+	// GroupDynamicSnapshotType represents a group snapshot that is being dynamically provisioned
+	GroupDynamicSnapshotType = snapshotProvisionType("group-dynamic")
+	// GroupPreProvisionedSnapshotType represents a group snapshot that is pre-provisioned
+	GroupPreProvisionedSnapshotType = snapshotProvisionType("group-pre-provisioned")
+
+	// GetMetadataAllocatedOper is the operation name for GetMetadataAllocated
+	GetMetadataAllocatedOper = "GetMetadataAllocated"
+	// GetMetadataDeltaOper is the operation name for GetMetadataDelta
+	GetMetadataDeltaOper = "GetMetadataDelta"
+
+	// The Group* operation name constants below are not yet wired into any
+	// gRPC handler: the server paths that would call OperationStart/
+	// RecordMetrics with these keys (e.g. a CreateGroupSnapshot or
+	// GetMetadataAllocatedGroup handler) live in server.go, which is not
+	// part of this package in this checkout. Wiring them in is left to
+	// whoever restores server.go.
+
+	// GetMetadataAllocatedGroupOper is the operation name for the group-snapshot
+	// variant of GetMetadataAllocated
+	GetMetadataAllocatedGroupOper = "GetMetadataAllocatedGroup"
+	// GetMetadataDeltaGroupOper is the operation name for the group-snapshot
+	// variant of GetMetadataDelta
+	GetMetadataDeltaGroupOper = "GetMetadataDeltaGroup"
+	// CreateGroupSnapshotOper is the operation name for creating a group snapshot
+	CreateGroupSnapshotOper = "CreateGroupSnapshot"
+	// DeleteGroupSnapshotOper is the operation name for deleting a group snapshot
+	DeleteGroupSnapshotOper = "DeleteGroupSnapshot"
+	// GroupSnapshotReadyOper is the operation name for waiting on a group snapshot
+	// to become ready
+	GroupSnapshotReadyOper = "GroupSnapshotReady"
 )
 
 var (
@@ -57,7 +103,22 @@ type OperationStatus interface {
 
 var metricBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 15, 30, 60, 120, 300, 600}
 
+// streamBytesBuckets are sized for CBT response chunk payloads, from 1KiB
+// to 64MiB.
+var streamBytesBuckets = []float64{1024, 8192, 65536, 262144, 1048576, 4194304, 16777216, 67108864}
+
 type MetricsManager interface {
+	// Start begins the background collection routines owned by this
+	// MetricsManager (e.g. the periodic in-flight-operations reconciler).
+	// It is safe to call only once; the supplied ctx governs the lifetime
+	// of the background work, and callers should also invoke Stop when
+	// they are done to release resources promptly.
+	Start(ctx context.Context) error
+
+	// Stop terminates the background collection routines started by Start.
+	// It is a no-op if Start was not called.
+	Stop()
+
 	// PrepareMetricsPath prepares the metrics path the specified pattern for
 	// metrics managed by this MetricsManager.
 	// If the "pattern" is empty (i.e., ""), it will not be registered.
@@ -82,6 +143,32 @@ type MetricsManager interface {
 
 	// GetRegistry() returns the metrics.KubeRegistry used by this metrics manager.
 	GetRegistry() k8smetrics.KubeRegistry
+
+	// StreamStart marks the start of a GetMetadataAllocated/GetMetadataDelta
+	// client stream for the given operation, incrementing the stream_active
+	// gauge. It is a no-op if OperationStart has not been called for op.
+	StreamStart(op OperationKey)
+
+	// StreamEnd marks the end of a streaming operation started by
+	// StreamStart, decrementing the stream_active gauge. It is a no-op if
+	// StreamStart was not previously called for op.
+	StreamEnd(op OperationKey)
+
+	// RecordStreamChunk records the size in bytes and the number of
+	// allocated/changed blocks carried by a single response chunk forwarded
+	// from the CSI driver for op. It is a no-op if OperationStart has not
+	// been called for op.
+	RecordStreamChunk(op OperationKey, bytes, blocks int)
+
+	// RecordRequestOutcome records the gRPC status code a request completed
+	// with, along with a stable, low-cardinality reason string (e.g.
+	// derived from an internal error-message prefix) so that authn/authz
+	// failures and CSI-not-ready storms can be observed and alerted on.
+	// op - the name of the operation the request was for.
+	// code - the gRPC status code the request completed with.
+	// reason - a stable, low-cardinality identifier for why the request
+	//          completed with that code; the empty string for success.
+	RecordRequestOutcome(op string, code codes.Code, reason string)
 }
 
 // OperationKey is a structure which holds information to
@@ -99,8 +186,20 @@ type OperationValue struct {
 	Driver string
 	// SnapshotType represents the snapshot type, for example: "dynamic", "pre-provisioned"
 	SnapshotType string
+	// GroupSnapshotHandle is the CSI handle of the VolumeGroupSnapshot this
+	// operation relates to. It is only set for group-snapshot metadata
+	// operations and is empty for single-snapshot operations.
+	GroupSnapshotHandle string
 	// startTime is the time when the operation first started
 	startTime time.Time
+	// streaming is set by StreamStart and cleared by StreamEnd
+	streaming bool
+}
+
+// IsGroup reports whether this operation is associated with a
+// VolumeGroupSnapshot rather than an individual VolumeSnapshot.
+func (v OperationValue) IsGroup() bool {
+	return v.GroupSnapshotHandle != ""
 }
 
 // NewOperationKey initializes a new OperationKey
@@ -123,6 +222,15 @@ func NewOperationValue(driver string, snapshotType snapshotProvisionType) Operat
 	}
 }
 
+// NewGroupOperationValue initializes a new OperationValue for a
+// VolumeGroupSnapshot metadata operation, recording the group snapshot
+// handle so it can be distinguished from individual snapshot operations.
+func NewGroupOperationValue(driver, groupSnapshotHandle string, snapshotType snapshotProvisionType) OperationValue {
+	val := NewOperationValue(driver, snapshotType)
+	val.GroupSnapshotHandle = groupSnapshotHandle
+	return val
+}
+
 type operationMetricsManager struct {
 	// cache is a concurrent-safe map which stores start timestamps for all
 	// ongoing operations.
@@ -139,16 +247,45 @@ type operationMetricsManager struct {
 	// opLatencyMetrics is a Histogram metrics for operation time per request
 	opLatencyMetrics *k8smetrics.HistogramVec
 
-	// opInFlight is a Gauge metric for the number of operations in flight
-	opInFlight *k8smetrics.Gauge
+	// opInFlight is a Gauge metric for the number of operations in flight,
+	// labeled by driver and snapshot type.
+	opInFlight *k8smetrics.GaugeVec
+
+	// streamBytes is a Histogram metric for the size of streamed response
+	// chunks.
+	streamBytes *k8smetrics.HistogramVec
+
+	// streamBlocksTotal is a Counter metric for the number of
+	// allocated/changed blocks reported across streamed response chunks.
+	streamBlocksTotal *k8smetrics.CounterVec
+
+	// streamActive is a Gauge metric for the number of currently open
+	// client streams.
+	streamActive *k8smetrics.GaugeVec
+
+	// requestsTotal is a Counter metric for completed requests, labeled by
+	// operation, gRPC status code and failure reason.
+	requestsTotal *k8smetrics.CounterVec
+
+	// cancel stops the background goroutine started by Start. It is nil
+	// until Start is called.
+	cancel context.CancelFunc
 }
 
-// NewMetricsManager creates a new MetricsManager instance
+// NewMetricsManager creates a new MetricsManager instance and starts its
+// background collection routines bound to the process lifetime. Start has
+// already been called on the returned MetricsManager; Stop ends the
+// background routines.
+//
+// TODO: once callers (e.g. the sidecar's Run()) are updated to manage the
+// MetricsManager's lifecycle explicitly, stop auto-starting here and let
+// Start/Stop be invoked alongside the rest of process startup/shutdown.
 func NewMetricsManager() MetricsManager {
 	mgr := &operationMetricsManager{
 		cache: make(map[OperationKey]OperationValue),
 	}
 	mgr.init()
+	_ = mgr.Start(context.Background())
 	return mgr
 }
 
@@ -160,16 +297,41 @@ func (opMgr *operationMetricsManager) OperationStart(key OperationKey, val Opera
 	if _, exists := opMgr.cache[key]; !exists {
 		val.startTime = time.Now()
 		opMgr.cache[key] = val
+		opMgr.opInFlight.WithLabelValues(val.Driver, val.SnapshotType).Inc()
 	}
-	opMgr.opInFlight.Set(float64(len(opMgr.cache)))
 }
 
 // DropOperation drops an operation
 func (opMgr *operationMetricsManager) DropOperation(op OperationKey) {
 	opMgr.mu.Lock()
 	defer opMgr.mu.Unlock()
-	delete(opMgr.cache, op)
-	opMgr.opInFlight.Set(float64(len(opMgr.cache)))
+
+	if val, exists := opMgr.cache[op]; exists {
+		delete(opMgr.cache, op)
+		opMgr.opInFlight.WithLabelValues(val.Driver, val.SnapshotType).Dec()
+	}
+}
+
+// recomputeInFlightLocked resets the in-flight gauge and recomputes the
+// number of in-flight operations for each driver/snapshot-type label pair
+// from the cache. It is run periodically by scheduleOpsInFlightMetric
+// rather than on every OperationStart/DropOperation, since a full Reset
+// and rebuild is only meant to correct any drift between the gauge and the
+// cache, not to be the steady-state update path. Operations still in the
+// cache stay counted. Callers must hold opMgr.mu.
+func (opMgr *operationMetricsManager) recomputeInFlightLocked() {
+	opMgr.opInFlight.Reset()
+
+	type label struct {
+		driver, snapshotType string
+	}
+	counts := make(map[label]int)
+	for _, val := range opMgr.cache {
+		counts[label{driver: val.Driver, snapshotType: val.SnapshotType}]++
+	}
+	for l, count := range counts {
+		opMgr.opInFlight.WithLabelValues(l.driver, l.snapshotType).Set(float64(count))
+	}
 }
 
 // RecordMetrics emits operation metrics
@@ -194,11 +356,67 @@ func (opMgr *operationMetricsManager) RecordMetrics(opKey OperationKey, opStatus
 	}
 
 	operationDuration := time.Since(opVal.startTime).Seconds()
-	opMgr.opLatencyMetrics.WithLabelValues(driverName, opKey.Name, opVal.Driver, strStatus).Observe(operationDuration)
+	opMgr.opLatencyMetrics.WithLabelValues(driverName, opKey.Name, strStatus, strconv.FormatBool(opVal.IsGroup()), opVal.SnapshotType).Observe(operationDuration)
 
 	delete(opMgr.cache, opKey)
+	opMgr.opInFlight.WithLabelValues(opVal.Driver, opVal.SnapshotType).Dec()
 }
 
+// StreamStart marks the start of a client stream for op
+func (opMgr *operationMetricsManager) StreamStart(op OperationKey) {
+	opMgr.mu.Lock()
+	defer opMgr.mu.Unlock()
+	opVal, exists := opMgr.cache[op]
+	if !exists || opVal.streaming {
+		return
+	}
+	opVal.streaming = true
+	opMgr.cache[op] = opVal
+	opMgr.streamActive.WithLabelValues(opVal.Driver, op.Name).Inc()
+}
+
+// StreamEnd marks the end of a client stream started by StreamStart for op
+func (opMgr *operationMetricsManager) StreamEnd(op OperationKey) {
+	opMgr.mu.Lock()
+	defer opMgr.mu.Unlock()
+	opVal, exists := opMgr.cache[op]
+	if !exists || !opVal.streaming {
+		return
+	}
+	opVal.streaming = false
+	opMgr.cache[op] = opVal
+	opMgr.streamActive.WithLabelValues(opVal.Driver, op.Name).Dec()
+}
+
+// RecordStreamChunk records metrics for a single streamed response chunk
+func (opMgr *operationMetricsManager) RecordStreamChunk(op OperationKey, bytes, blocks int) {
+	opMgr.mu.Lock()
+	defer opMgr.mu.Unlock()
+	opVal, exists := opMgr.cache[op]
+	if !exists {
+		return
+	}
+	opMgr.streamBytes.WithLabelValues(opVal.Driver, op.Name, opVal.SnapshotType).Observe(float64(bytes))
+	opMgr.streamBlocksTotal.WithLabelValues(opVal.Driver, op.Name, opVal.SnapshotType).Add(float64(blocks))
+}
+
+// RecordRequestOutcome records the outcome of a completed request. This
+// does not require the operation to have been cached via OperationStart,
+// as it is intended to cover requests that are rejected before an
+// operation is tracked (e.g. authn/authz failures).
+func (opMgr *operationMetricsManager) RecordRequestOutcome(op string, code codes.Code, reason string) {
+	opMgr.requestsTotal.WithLabelValues(op, code.String(), reason).Inc()
+}
+
+// init initializes the Prometheus metrics managed by this MetricsManager.
+//
+// Migration note: snapshot_metadata_controller_operation_total_seconds now
+// carries additional "is_group_snapshot" and "snapshot_type" labels, and
+// snapshot_metadata_controller_operations_in_flight changed from an
+// unlabeled Gauge to a GaugeVec labeled by "driver_name" and
+// "snapshot_type". Scrapers/alerting rules that assumed a single
+// in-flight series should aggregate across both labels (e.g. with a
+// plain `sum` in PromQL) to preserve prior behavior.
 func (opMgr *operationMetricsManager) init() {
 	opMgr.registry = k8smetrics.NewKubeRegistry()
 	k8smetrics.RegisterProcessStartTime(opMgr.registry.Register)
@@ -209,39 +427,100 @@ func (opMgr *operationMetricsManager) init() {
 			Help:      operationLatencyMetricHelpMsg,
 			Buckets:   metricBuckets,
 		},
-		[]string{labelDriverName, labelOperationName, labelOperationStatus},
+		[]string{labelDriverName, labelOperationName, labelOperationStatus, labelSnapshotGroup, labelSnapshotType},
 	)
 	opMgr.registry.MustRegister(opMgr.opLatencyMetrics)
-	opMgr.opInFlight = k8smetrics.NewGauge(
+	opMgr.opInFlight = k8smetrics.NewGaugeVec(
 		&k8smetrics.GaugeOpts{
 			Subsystem: subSystem,
 			Name:      operationInFlightName,
 			Help:      operationInFlightHelpMsg,
 		},
+		[]string{labelDriverName, labelSnapshotType},
 	)
 	opMgr.registry.MustRegister(opMgr.opInFlight)
+	opMgr.streamBytes = k8smetrics.NewHistogramVec(
+		&k8smetrics.HistogramOpts{
+			Subsystem: subSystem,
+			Name:      streamBytesMetricName,
+			Help:      streamBytesMetricHelpMsg,
+			Buckets:   streamBytesBuckets,
+		},
+		[]string{labelDriverName, labelOperationName, labelSnapshotType},
+	)
+	opMgr.registry.MustRegister(opMgr.streamBytes)
+	opMgr.streamBlocksTotal = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Subsystem: subSystem,
+			Name:      streamBlocksTotalMetricName,
+			Help:      streamBlocksTotalMetricHelp,
+		},
+		[]string{labelDriverName, labelOperationName, labelSnapshotType},
+	)
+	opMgr.registry.MustRegister(opMgr.streamBlocksTotal)
+	opMgr.streamActive = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Subsystem: subSystem,
+			Name:      streamActiveName,
+			Help:      streamActiveHelpMsg,
+		},
+		[]string{labelDriverName, labelOperationName},
+	)
+	opMgr.registry.MustRegister(opMgr.streamActive)
+	opMgr.requestsTotal = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Subsystem: subSystem,
+			Name:      requestsTotalName,
+			Help:      requestsTotalHelp,
+		},
+		[]string{labelOperationName, labelRequestCode, labelRequestReason},
+	)
+	opMgr.registry.MustRegister(opMgr.requestsTotal)
+}
+
+// Start begins the background in-flight-operations reconciler. The
+// goroutine runs until the supplied context is cancelled or Stop is called.
+func (opMgr *operationMetricsManager) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+
+	opMgr.mu.Lock()
+	opMgr.cancel = cancel
+	opMgr.mu.Unlock()
 
 	// While we always maintain the number of operations in flight
 	// for every metrics operation start/finish, if any are leaked,
 	// this scheduled routine will catch any leaked operations.
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
 	go opMgr.scheduleOpsInFlightMetric(ctx)
+
+	return nil
+}
+
+// Stop terminates the background in-flight-operations reconciler started
+// by Start.
+func (opMgr *operationMetricsManager) Stop() {
+	opMgr.mu.Lock()
+	cancel := opMgr.cancel
+	opMgr.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
 }
 
 func (opMgr *operationMetricsManager) scheduleOpsInFlightMetric(ctx context.Context) {
+	ticker := time.NewTicker(inFlightCheckInterval)
+	defer ticker.Stop()
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		default:
-			for range time.NewTicker(inFlightCheckInterval).C {
-				func() {
-					opMgr.mu.Lock()
-					defer opMgr.mu.Unlock()
-					opMgr.opInFlight.Set(float64(len(opMgr.cache)))
-				}()
-			}
+		case <-ticker.C:
+			func() {
+				opMgr.mu.Lock()
+				defer opMgr.mu.Unlock()
+				opMgr.recomputeInFlightLocked()
+			}()
 		}
 	}
 }
@@ -262,4 +541,4 @@ func (opMgr *operationMetricsManager) GetRegistry() k8smetrics.KubeRegistry {
 }
 
 // snapshotProvisionType represents which kind of snapshot a metric is
-type snapshotProvisionType string
\ No newline at end of file
+type snapshotProvisionType string
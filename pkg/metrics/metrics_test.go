@@ -0,0 +1,242 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"k8s.io/apimachinery/pkg/types"
+	k8smetrics "k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func newTestManager(t *testing.T) *operationMetricsManager {
+	mgr := &operationMetricsManager{
+		cache: make(map[OperationKey]OperationValue),
+	}
+	mgr.init()
+	t.Cleanup(mgr.Stop)
+	return mgr
+}
+
+// gaugeValue reads the current value of a GaugeMetric, failing the test if
+// it cannot be read.
+func gaugeValue(t *testing.T, m k8smetrics.GaugeMetric) float64 {
+	t.Helper()
+	v, err := testutil.GetGaugeMetricValue(m)
+	assert.NoError(t, err)
+	return v
+}
+
+// counterValue reads the current value of a CounterMetric, failing the test
+// if it cannot be read.
+func counterValue(t *testing.T, m k8smetrics.CounterMetric) float64 {
+	t.Helper()
+	v, err := testutil.GetCounterMetricValue(m)
+	assert.NoError(t, err)
+	return v
+}
+
+// histogramCount reads the observation count of an ObserverMetric, failing
+// the test if it cannot be read.
+func histogramCount(t *testing.T, m k8smetrics.ObserverMetric) uint64 {
+	t.Helper()
+	v, err := testutil.GetHistogramMetricCount(m)
+	assert.NoError(t, err)
+	return v
+}
+
+func TestOperationStartDropOperationMaintainsInFlight(t *testing.T) {
+	mgr := newTestManager(t)
+
+	keyA := NewOperationKey(GetMetadataAllocatedOper, types.UID("vol-a"))
+	keyB := NewOperationKey(GetMetadataAllocatedOper, types.UID("vol-b"))
+	keyC := NewOperationKey(GetMetadataDeltaOper, types.UID("vol-c"))
+
+	mgr.OperationStart(keyA, NewOperationValue("driver1", DynamicSnapshotType))
+	mgr.OperationStart(keyB, NewOperationValue("driver1", DynamicSnapshotType))
+	mgr.OperationStart(keyC, NewOperationValue("driver2", PreProvisionedSnapshotType))
+
+	assert.Equal(t, float64(2), gaugeValue(t, mgr.opInFlight.WithLabelValues("driver1", string(DynamicSnapshotType))))
+	assert.Equal(t, float64(1), gaugeValue(t, mgr.opInFlight.WithLabelValues("driver2", string(PreProvisionedSnapshotType))))
+
+	mgr.DropOperation(keyA)
+
+	assert.Equal(t, float64(1), gaugeValue(t, mgr.opInFlight.WithLabelValues("driver1", string(DynamicSnapshotType))))
+	assert.Equal(t, float64(1), gaugeValue(t, mgr.opInFlight.WithLabelValues("driver2", string(PreProvisionedSnapshotType))))
+
+	mgr.DropOperation(keyB)
+	mgr.DropOperation(keyC)
+
+	assert.Equal(t, float64(0), gaugeValue(t, mgr.opInFlight.WithLabelValues("driver1", string(DynamicSnapshotType))))
+	assert.Equal(t, float64(0), gaugeValue(t, mgr.opInFlight.WithLabelValues("driver2", string(PreProvisionedSnapshotType))))
+}
+
+func TestRecomputeInFlightLocked(t *testing.T) {
+	mgr := newTestManager(t)
+
+	keyA := NewOperationKey(GetMetadataAllocatedOper, types.UID("vol-a"))
+	keyB := NewOperationKey(GetMetadataDeltaOper, types.UID("vol-b"))
+
+	// Populate the cache directly, bypassing OperationStart, simulating
+	// drift where the in-flight gauge fell out of sync with the cache.
+	mgr.mu.Lock()
+	mgr.cache[keyA] = NewOperationValue("driver1", DynamicSnapshotType)
+	mgr.cache[keyB] = NewOperationValue("driver1", DynamicSnapshotType)
+	mgr.opInFlight.Reset()
+	mgr.recomputeInFlightLocked()
+	mgr.mu.Unlock()
+
+	assert.Equal(t, float64(2), gaugeValue(t, mgr.opInFlight.WithLabelValues("driver1", string(DynamicSnapshotType))))
+
+	mgr.mu.Lock()
+	delete(mgr.cache, keyA)
+	mgr.recomputeInFlightLocked()
+	mgr.mu.Unlock()
+
+	assert.Equal(t, float64(1), gaugeValue(t, mgr.opInFlight.WithLabelValues("driver1", string(DynamicSnapshotType))))
+}
+
+func TestRecordMetricsDecrementsInFlight(t *testing.T) {
+	mgr := newTestManager(t)
+
+	key := NewOperationKey(GetMetadataAllocatedOper, types.UID("vol-1"))
+	mgr.OperationStart(key, NewOperationValue("driver1", DynamicSnapshotType))
+
+	assert.Equal(t, float64(1), gaugeValue(t, mgr.opInFlight.WithLabelValues("driver1", string(DynamicSnapshotType))))
+
+	mgr.RecordMetrics(key, nil, "driver1")
+
+	assert.Equal(t, float64(0), gaugeValue(t, mgr.opInFlight.WithLabelValues("driver1", string(DynamicSnapshotType))))
+}
+
+func TestOperationValueIsGroup(t *testing.T) {
+	assert.False(t, NewOperationValue("driver1", DynamicSnapshotType).IsGroup())
+	assert.True(t, NewGroupOperationValue("driver1", "vgs-handle-1", GroupDynamicSnapshotType).IsGroup())
+}
+
+func TestRecordMetricsGroupSnapshotLabels(t *testing.T) {
+	mgr := newTestManager(t)
+
+	key := NewOperationKey(CreateGroupSnapshotOper, types.UID("vgs-1"))
+	mgr.OperationStart(key, NewGroupOperationValue("driver1", "vgs-handle-1", GroupDynamicSnapshotType))
+
+	mgr.RecordMetrics(key, nil, "driver1")
+
+	// The recorded latency sample must land on the group snapshot's own
+	// is_group_snapshot/snapshot_type label pair, not the single-snapshot
+	// defaults.
+	count := histogramCount(t, mgr.opLatencyMetrics.WithLabelValues(
+		"driver1", CreateGroupSnapshotOper, opStatusUnknown, "true", string(GroupDynamicSnapshotType)))
+	assert.Equal(t, uint64(1), count)
+}
+
+func TestRecordStreamChunk(t *testing.T) {
+	mgr := newTestManager(t)
+
+	key := NewOperationKey(GetMetadataAllocatedOper, types.UID("vol-1"))
+	mgr.OperationStart(key, NewOperationValue("driver1", DynamicSnapshotType))
+
+	// Two chunks, exercising the full driver/operation/snapshot-type label
+	// set on both the histogram and the counter without panicking on a
+	// WithLabelValues count mismatch.
+	mgr.RecordStreamChunk(key, 4096, 3)
+	mgr.RecordStreamChunk(key, 2048, 1)
+
+	assert.Equal(t, float64(4), counterValue(t,
+		mgr.streamBlocksTotal.WithLabelValues("driver1", GetMetadataAllocatedOper, string(DynamicSnapshotType))))
+	assert.Equal(t, uint64(2), histogramCount(t,
+		mgr.streamBytes.WithLabelValues("driver1", GetMetadataAllocatedOper, string(DynamicSnapshotType))))
+
+	// An uncached operation is a no-op, not a panic.
+	assert.NotPanics(t, func() {
+		mgr.RecordStreamChunk(NewOperationKey(GetMetadataDeltaOper, types.UID("unknown")), 1, 1)
+	})
+}
+
+func TestStreamStartEnd(t *testing.T) {
+	mgr := newTestManager(t)
+
+	key := NewOperationKey(GetMetadataAllocatedOper, types.UID("vol-1"))
+	mgr.OperationStart(key, NewOperationValue("driver1", DynamicSnapshotType))
+
+	mgr.StreamStart(key)
+	assert.Equal(t, float64(1), gaugeValue(t, mgr.streamActive.WithLabelValues("driver1", GetMetadataAllocatedOper)))
+
+	mgr.StreamEnd(key)
+	assert.Equal(t, float64(0), gaugeValue(t, mgr.streamActive.WithLabelValues("driver1", GetMetadataAllocatedOper)))
+}
+
+func TestRecordRequestOutcome(t *testing.T) {
+	mgr := newTestManager(t)
+
+	mgr.RecordRequestOutcome(GetMetadataAllocatedOper, codes.PermissionDenied, "permission_denied")
+	mgr.RecordRequestOutcome(GetMetadataAllocatedOper, codes.PermissionDenied, "permission_denied")
+	mgr.RecordRequestOutcome(GetMetadataAllocatedOper, codes.OK, "")
+
+	assert.Equal(t, float64(2), counterValue(t,
+		mgr.requestsTotal.WithLabelValues(GetMetadataAllocatedOper, codes.PermissionDenied.String(), "permission_denied")))
+	assert.Equal(t, float64(1), counterValue(t,
+		mgr.requestsTotal.WithLabelValues(GetMetadataAllocatedOper, codes.OK.String(), "")))
+}
+
+func TestStartStop(t *testing.T) {
+	origInterval := inFlightCheckInterval
+	inFlightCheckInterval = 10 * time.Millisecond
+	t.Cleanup(func() { inFlightCheckInterval = origInterval })
+
+	mgr := &operationMetricsManager{
+		cache: make(map[OperationKey]OperationValue),
+	}
+	mgr.init()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	assert.NoError(t, mgr.Start(ctx))
+
+	key := NewOperationKey(GetMetadataAllocatedOper, types.UID("vol-1"))
+	mgr.OperationStart(key, NewOperationValue("driver1", DynamicSnapshotType))
+
+	// Simulate a leaked operation: corrupt the gauge directly, bypassing
+	// DropOperation/RecordMetrics, and rely on the background reconciler
+	// started by Start to catch it.
+	mgr.mu.Lock()
+	mgr.opInFlight.Reset()
+	mgr.mu.Unlock()
+
+	assert.Eventually(t, func() bool {
+		v, err := testutil.GetGaugeMetricValue(mgr.opInFlight.WithLabelValues("driver1", string(DynamicSnapshotType)))
+		return err == nil && v == 1
+	}, time.Second, 5*time.Millisecond, "background reconciler did not restore the in-flight gauge")
+
+	cancel()
+	mgr.Stop() // Stop after the context is already cancelled must not block or panic.
+}
+
+func TestStopWithoutStart(t *testing.T) {
+	mgr := &operationMetricsManager{
+		cache: make(map[OperationKey]OperationValue),
+	}
+	mgr.init()
+
+	assert.NotPanics(t, mgr.Stop)
+}